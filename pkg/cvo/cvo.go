@@ -1,49 +1,63 @@
 package cvo
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/uuid"
+	configclientset "github.com/openshift/client-go/config/clientset/versioned"
+	configinformersv1 "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configlisterv1 "github.com/openshift/client-go/config/listers/config/v1"
 	"github.com/openshift/cluster-version-operator/lib/resourceapply"
 	cvv1 "github.com/openshift/cluster-version-operator/pkg/apis/clusterversion.openshift.io/v1"
-	osv1 "github.com/openshift/cluster-version-operator/pkg/apis/operatorstatus.openshift.io/v1"
 	clientset "github.com/openshift/cluster-version-operator/pkg/generated/clientset/versioned"
 	cvinformersv1 "github.com/openshift/cluster-version-operator/pkg/generated/informers/externalversions/clusterversion.openshift.io/v1"
-	osinformersv1 "github.com/openshift/cluster-version-operator/pkg/generated/informers/externalversions/operatorstatus.openshift.io/v1"
 	cvlistersv1 "github.com/openshift/cluster-version-operator/pkg/generated/listers/clusterversion.openshift.io/v1"
-	oslistersv1 "github.com/openshift/cluster-version-operator/pkg/generated/listers/operatorstatus.openshift.io/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
 	corev1 "k8s.io/api/core/v1"
 	apiextclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
-	apiextinformersv1beta1 "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions/apiextensions/v1beta1"
-	apiextlistersv1beta1 "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	appsinformersv1 "k8s.io/client-go/informers/apps/v1"
+	"k8s.io/client-go/informers"
+	coreinformersv1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	coreclientsetv1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	appslisterv1 "k8s.io/client-go/listers/apps/v1"
+	corelisterv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	"k8s.io/client-go/util/workqueue"
 )
 
 const (
-	// maxRetries is the number of times a machineconfig pool will be retried before it is dropped out of the queue.
-	// With the current rate-limiter in use (5ms*2^(maxRetries-1)) the following numbers represent the times
-	// a machineconfig pool is going to be requeued:
-	//
-	// 5ms, 10ms, 20ms, 40ms, 80ms, 160ms, 320ms, 640ms, 1.3s, 2.6s, 5.1s, 10.2s, 20.4s, 41s, 82s
+	// maxRetries is the number of consecutive sync failures tolerated before
+	// Degraded is reported instead of just retried. The Degraded message
+	// states the failure count; it does not carry the last sync error.
 	maxRetries = 15
 
-	// installconfigKey is the key in ConfigMap that stores the InstallConfig.
-	installconfigKey = "installconfig"
+	// installConfigNamespace and installConfigName locate the ConfigMap the
+	// installer leaves behind with the cluster's InstallConfig.
+	installConfigNamespace = "kube-system"
+	installConfigName      = "cluster-config-v1"
+
+	// installconfigKey is the key in the ConfigMap that stores the InstallConfig.
+	installconfigKey = "install-config"
+
+	// defaultUpstream is used when the InstallConfig does not specify an
+	// update service.
+	defaultUpstream = "https://api.openshift.com/api/upgrades_info/v1/graph"
 
 	workQueueKey = "kube-system/installconfig"
+
+	// syncTimeout bounds how long a single work item sync may run. A stuck
+	// payload apply cancels its context and returns to the queue instead of
+	// wedging a worker forever.
+	syncTimeout = 4 * time.Minute
 )
 
 // ownerKind contains the schema.GroupVersionKind for type that owns objects managed by CVO.
@@ -53,29 +67,45 @@ var ownerKind = cvv1.SchemeGroupVersion.WithKind("CVOConfig")
 type Operator struct {
 	// nodename allows CVO to sync fetchPayload to same node as itself.
 	nodename string
-	// namespace and name are used to find the CVOConfig, OperatorStatus.
+	// namespace and name are used to find the CVOConfig and ClusterOperator.
 	namespace, name string
 
 	// restConfig is used to create resourcebuilder.
 	restConfig *rest.Config
 
-	client        clientset.Interface
-	kubeClient    kubernetes.Interface
-	apiExtClient  apiextclientset.Interface
-	eventRecorder record.EventRecorder
-
-	syncHandler func(key string) error
-
-	cvoConfigLister      cvlistersv1.CVOConfigLister
-	operatorStatusLister oslistersv1.OperatorStatusLister
-
-	crdLister          apiextlistersv1beta1.CustomResourceDefinitionLister
-	deployLister       appslisterv1.DeploymentLister
-	crdListerSynced    cache.InformerSynced
-	deployListerSynced cache.InformerSynced
-
-	// queue only ever has one item, but it has nice error handling backoff/retry semantics
-	queue workqueue.RateLimitingInterface
+	client         clientset.Interface
+	kubeClient     kubernetes.Interface
+	apiExtClient   apiextclientset.Interface
+	configClient   configclientset.Interface
+	metadataClient metadata.Interface
+	eventRecorder  record.EventRecorder
+
+	// controller drives sync via a library-go controller factory in place of
+	// a hand-rolled workqueue/worker loop. It reuses workqueue's default
+	// rate limiter, so the maxRetries backoff curve is unchanged.
+	controller factory.Controller
+	// controllerRecorder is the events.Recorder the factory's Controller
+	// expects. It is a separate kube recorder for namespace, not a wrapper
+	// around eventRecorder.
+	controllerRecorder events.Recorder
+
+	cvoConfigLister cvlistersv1.CVOConfigLister
+
+	// clusterOperatorLister backs the ClusterOperator status CVO reports
+	// for itself.
+	clusterOperatorLister configlisterv1.ClusterOperatorLister
+
+	// crdLister and deployLister come from metadata-only informers: for a
+	// payload that ships hundreds of CRDs, deserializing full spec/status just
+	// to observe existence and generation bloats CVO's heap. syncCVOCRDs and
+	// payload reconciliation only ever need *metav1.PartialObjectMetadata, so
+	// that is all these caches hold; full clients are still used to apply.
+	crdLister    cache.GenericLister
+	deployLister cache.GenericLister
+
+	// configMapLister is used to read the kube-system InstallConfig that
+	// getConfig derives the CVOConfig from.
+	configMapLister corelisterv1.ConfigMapLister
 }
 
 // New returns a new cluster version operator.
@@ -83,113 +113,140 @@ func New(
 	nodename string,
 	namespace, name string,
 	cvoConfigInformer cvinformersv1.CVOConfigInformer,
-	operatorStatusInformer osinformersv1.OperatorStatusInformer,
-	crdInformer apiextinformersv1beta1.CustomResourceDefinitionInformer,
-	deployInformer appsinformersv1.DeploymentInformer,
+	clusterOperatorInformer configinformersv1.ClusterOperatorInformer,
+	crdInformer informers.GenericInformer,
+	deployInformer informers.GenericInformer,
+	configMapInformer coreinformersv1.ConfigMapInformer,
 	restConfig *rest.Config,
 	client clientset.Interface,
 	kubeClient kubernetes.Interface,
 	apiExtClient apiextclientset.Interface,
+	configClient configclientset.Interface,
+	metadataClient metadata.Interface,
 ) *Operator {
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(glog.Infof)
 	eventBroadcaster.StartRecordingToSink(&coreclientsetv1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
 
 	optr := &Operator{
-		nodename:      nodename,
-		namespace:     namespace,
-		name:          name,
-		restConfig:    restConfig,
-		client:        client,
-		kubeClient:    kubeClient,
-		apiExtClient:  apiExtClient,
-		eventRecorder: eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "clusterversionoperator"}),
-		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "clusterversionoperator"),
+		nodename:       nodename,
+		namespace:      namespace,
+		name:           name,
+		restConfig:     restConfig,
+		client:         client,
+		kubeClient:     kubeClient,
+		apiExtClient:   apiExtClient,
+		configClient:   configClient,
+		metadataClient: metadataClient,
+		eventRecorder:  eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "clusterversionoperator"}),
 	}
-
-	cvoConfigInformer.Informer().AddEventHandler(optr.eventHandler())
-	crdInformer.Informer().AddEventHandler(optr.eventHandler())
-
-	optr.syncHandler = optr.sync
+	optr.controllerRecorder = events.NewKubeRecorder(kubeClient.CoreV1().Events(namespace), "cluster-version-operator", &corev1.ObjectReference{
+		Kind:      "Pod",
+		Namespace: namespace,
+		Name:      nodename,
+	})
 
 	optr.cvoConfigLister = cvoConfigInformer.Lister()
-	optr.operatorStatusLister = operatorStatusInformer.Lister()
+
+	optr.clusterOperatorLister = clusterOperatorInformer.Lister()
 
 	optr.crdLister = crdInformer.Lister()
-	optr.crdListerSynced = crdInformer.Informer().HasSynced
 	optr.deployLister = deployInformer.Lister()
-	optr.deployListerSynced = deployInformer.Informer().HasSynced
+
+	optr.configMapLister = configMapInformer.Lister()
+
+	optr.controller = factory.New().
+		WithInformersQueueKeyFunc(
+			func(obj runtime.Object) string { return workQueueKey },
+			cvoConfigInformer.Informer(),
+			clusterOperatorInformer.Informer(),
+			crdInformer.Informer(),
+			deployInformer.Informer(),
+			configMapInformer.Informer(),
+		).
+		WithSync(optr.syncFactory).
+		WithPostStartHooks(optr.degradedStatusWriter).
+		ResyncEvery(2*time.Minute).
+		ToController("ClusterVersionOperator", optr.controllerRecorder)
 
 	return optr
 }
 
-// Run runs the cluster version operator.
+// Run runs the cluster version operator until stopCh is closed. It derives a
+// cancellable context from stopCh and is a thin shim over RunContext kept for
+// callers that have not yet moved to context-based shutdown.
 func (optr *Operator) Run(workers int, stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	optr.RunContext(ctx, workers)
+}
+
+// RunContext runs the cluster version operator until ctx is cancelled. Cache
+// sync, work distribution, and retry/backoff are all owned by the library-go
+// controller built in New(); this is now a thin wrapper around it.
+func (optr *Operator) RunContext(ctx context.Context, workers int) {
 	defer utilruntime.HandleCrash()
-	defer optr.queue.ShutDown()
 
 	glog.Info("Starting ClusterVersionOperator")
 	defer glog.Info("Shutting down ClusterVersionOperator")
 
-	if !cache.WaitForCacheSync(stopCh,
-		optr.crdListerSynced,
-		optr.deployListerSynced,
-	) {
-		return
-	}
-
-	for i := 0; i < workers; i++ {
-		go wait.Until(optr.worker, time.Second, stopCh)
-	}
-
-	<-stopCh
+	optr.controller.Run(ctx, workers)
 }
 
-func (optr *Operator) eventHandler() cache.ResourceEventHandler {
-	return cache.ResourceEventHandlerFuncs{
-		AddFunc:    func(obj interface{}) { optr.queue.Add(workQueueKey) },
-		UpdateFunc: func(old, new interface{}) { optr.queue.Add(workQueueKey) },
-		DeleteFunc: func(obj interface{}) { optr.queue.Add(workQueueKey) },
-	}
-}
-
-func (optr *Operator) worker() {
-	for optr.processNextWorkItem() {
+// syncFactory adapts sync to factory.Controller's sync signature. Returning
+// the error lets the factory's own workqueue (the same
+// workqueue.DefaultControllerRateLimiter used by the old hand-rolled queue)
+// own retry/backoff; degradedStatusWriter is what turns a run of maxRetries
+// failures into a Degraded condition.
+func (optr *Operator) syncFactory(ctx context.Context, syncCtx factory.SyncContext) error {
+	if err := optr.sync(ctx, syncCtx.QueueKey()); err != nil {
+		glog.V(2).Infof("Error syncing operator %q: %v", syncCtx.QueueKey(), err)
+		return err
 	}
+	return nil
 }
 
-func (optr *Operator) processNextWorkItem() bool {
-	key, quit := optr.queue.Get()
-	if quit {
-		return false
+// degradedStatusWriter is a PostStartHook that watches the controller's own
+// queue for the work item being requeued maxRetries times in a row and, when
+// that happens, reports the terminal failure as Degraded and forgets the
+// item so the backoff (and this check) starts over. A PostStartHook runs once
+// for the lifetime of the controller, in its own goroutine, not per processed
+// item, so syncCtx here is not the per-item context a real sync gets; key is
+// hardcoded to workQueueKey rather than read off syncCtx.QueueKey(), since
+// every informer in New() is wired to fan into that single well-known key.
+func (optr *Operator) degradedStatusWriter(ctx context.Context, syncCtx factory.SyncContext) error {
+	queue := syncCtx.Queue()
+	key := workQueueKey
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if queue.NumRequeues(key) < maxRetries {
+				continue
+			}
+			err := fmt.Errorf("sync has failed %d times in a row", maxRetries)
+			glog.V(2).Infof("Reporting operator %q degraded and resetting its backoff after %d failed attempts: %v", key, maxRetries, err)
+			if err := optr.syncDegradedStatus(ctx, err); err != nil {
+				utilruntime.HandleError(err)
+			}
+			queue.Forget(key)
+		}
 	}
-	defer optr.queue.Done(key)
-
-	err := optr.syncHandler(key.(string))
-	optr.handleErr(err, key)
-
-	return true
 }
 
-func (optr *Operator) handleErr(err error, key interface{}) {
-	if err == nil {
-		optr.queue.Forget(key)
-		return
-	}
-
-	if optr.queue.NumRequeues(key) < maxRetries {
-		glog.V(2).Infof("Error syncing operator %v: %v", key, err)
-		optr.queue.AddRateLimited(key)
-		return
-	}
+func (optr *Operator) sync(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
 
-	err = optr.syncDegradedStatus(err)
-	utilruntime.HandleError(err)
-	glog.V(2).Infof("Dropping operator %q out of the queue: %v", key, err)
-	optr.queue.Forget(key)
-}
-
-func (optr *Operator) sync(key string) error {
 	startTime := time.Now()
 	glog.V(4).Infof("Started syncing operator %q (%v)", key, startTime)
 	defer func() {
@@ -197,46 +254,59 @@ func (optr *Operator) sync(key string) error {
 	}()
 
 	// We always run this to make sure CVOConfig can be synced.
-	if err := optr.syncCVOCRDs(); err != nil {
+	if err := optr.syncCVOCRDs(ctx); err != nil {
 		return err
 	}
 
-	config, err := optr.getConfig()
+	config, err := optr.getConfig(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err := optr.syncStatus(config, osv1.OperatorStatusCondition{Type: osv1.OperatorStatusConditionTypeWorking, Message: fmt.Sprintf("Working towards %s", config)}); err != nil {
+	if err := optr.syncLogLevel(ctx, config); err != nil {
 		return err
 	}
 
-	payload, err := optr.syncUpdatePayloadContents(updatePayloadsPathPrefix, config)
+	if err := optr.syncStatus(ctx, config, true, fmt.Sprintf("Working towards %s", config)); err != nil {
+		return err
+	}
+
+	payload, err := optr.syncUpdatePayloadContents(ctx, updatePayloadsPathPrefix, config)
 	if err != nil {
 		return err
 	}
 
-	if err := optr.syncUpdatePayload(config, payload); err != nil {
+	if err := optr.syncUpdatePayload(ctx, config, payload); err != nil {
 		return err
 	}
 
-	return optr.syncStatus(config, osv1.OperatorStatusCondition{Type: osv1.OperatorStatusConditionTypeDone, Message: fmt.Sprintf("Done applying %s", config)})
+	return optr.syncStatus(ctx, config, false, fmt.Sprintf("Done applying %s", config))
 }
 
-func (optr *Operator) getConfig() (*cvv1.CVOConfig, error) {
-	// XXX: fetch upstream, channel, cluster ID from InstallConfig
-	upstream := cvv1.URL("http://localhost:8080/graph")
-	channel := "fast"
-	id, _ := uuid.NewRandom()
+func (optr *Operator) getConfig(ctx context.Context) (*cvv1.CVOConfig, error) {
+	installConfig, err := optr.getInstallConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterID, err := optr.currentOrNewClusterID()
+	if err != nil {
+		return nil, err
+	}
+
+	upstream := cvv1.URL(defaultUpstream)
+	if installConfig.UpdateService != "" {
+		upstream = cvv1.URL(installConfig.UpdateService)
+	}
 
-	// XXX: generate CVOConfig from options calculated above.
 	config := &cvv1.CVOConfig{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: optr.namespace,
 			Name:      optr.name,
 		},
 		Upstream:  upstream,
-		Channel:   channel,
-		ClusterID: id,
+		Channel:   installConfig.Channel,
+		ClusterID: clusterID,
 	}
 	if config.ClusterID.Variant() != uuid.RFC4122 {
 		return nil, fmt.Errorf("invalid ClusterID %q, must be an RFC4122-variant UUID: found %s", config.ClusterID, config.ClusterID.Variant())
@@ -245,6 +315,6 @@ func (optr *Operator) getConfig() (*cvv1.CVOConfig, error) {
 		return nil, fmt.Errorf("Invalid ClusterID %q, must be a version-4 UUID: found %s", config.ClusterID, config.ClusterID.Version())
 	}
 
-	actual, _, err := resourceapply.ApplyCVOConfigFromCache(optr.cvoConfigLister, optr.client.ClusterversionV1(), config)
+	actual, _, err := resourceapply.ApplyCVOConfigFromCache(ctx, optr.cvoConfigLister, optr.client.ClusterversionV1(), config)
 	return actual, err
 }
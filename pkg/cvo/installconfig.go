@@ -0,0 +1,58 @@
+package cvo
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/uuid"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// installConfig is the minimal subset of the installer's InstallConfig that
+// getConfig needs. It is intentionally loose (most fields are left
+// unmarshalled) so CVO does not need to track every field the installer adds.
+type installConfig struct {
+	BaseDomain string `json:"baseDomain"`
+	Metadata   struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Networking    map[string]interface{} `json:"networking"`
+	UpdateService string                 `json:"updateService"`
+	Channel       string                 `json:"channel"`
+}
+
+// getInstallConfig reads and decodes the InstallConfig the installer leaves
+// in the kube-system/cluster-config-v1 ConfigMap.
+func (optr *Operator) getInstallConfig() (*installConfig, error) {
+	cm, err := optr.configMapLister.ConfigMaps(installConfigNamespace).Get(installConfigName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get install config: %v", err)
+	}
+
+	raw, ok := cm.Data[installconfigKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s/%s has no %q key", installConfigNamespace, installConfigName, installconfigKey)
+	}
+
+	ic := &installConfig{}
+	if err := yaml.Unmarshal([]byte(raw), ic); err != nil {
+		return nil, fmt.Errorf("failed to parse install config: %v", err)
+	}
+	return ic, nil
+}
+
+// currentOrNewClusterID returns the ClusterID already persisted on the
+// CVOConfig, if any, and otherwise generates a new one. Once a ClusterID is
+// stored it must never be silently regenerated, since it is used to identify
+// the cluster to the update service.
+func (optr *Operator) currentOrNewClusterID() (uuid.UUID, error) {
+	existing, err := optr.cvoConfigLister.CVOConfigs(optr.namespace).Get(optr.name)
+	if err == nil {
+		return existing.ClusterID, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return uuid.UUID{}, fmt.Errorf("failed to get existing CVOConfig: %v", err)
+	}
+	return uuid.NewRandom()
+}
@@ -0,0 +1,62 @@
+package cvo
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/golang/glog"
+
+	"github.com/openshift/cluster-version-operator/lib/resourceapply"
+	cvv1 "github.com/openshift/cluster-version-operator/pkg/apis/clusterversion.openshift.io/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// logLevelVerbosity maps a CVOConfig LogLevel to the klog/glog -v verbosity
+// that produces it. The gaps between values leave room for operators to still
+// pass fine-grained -v flags without colliding with a level this controller sets.
+var logLevelVerbosity = map[cvv1.LogLevel]int{
+	cvv1.LogLevelNormal:   2,
+	cvv1.LogLevelDebug:    4,
+	cvv1.LogLevelTrace:    6,
+	cvv1.LogLevelTraceAll: 8,
+}
+
+// syncLogLevel applies config.LogLevel as the effective verbosity of the
+// process's logging flag and reflects the level CVO actually applied back onto
+// config.CurrentLogLevel so status never claims a level the pod isn't running at.
+func (optr *Operator) syncLogLevel(ctx context.Context, config *cvv1.CVOConfig) error {
+	level := config.LogLevel
+	if level == "" {
+		level = cvv1.LogLevelNormal
+	}
+
+	verbosity, ok := logLevelVerbosity[level]
+	if !ok {
+		return fmt.Errorf("unrecognized log level %q", level)
+	}
+
+	vFlag := flag.Lookup("v")
+	if vFlag == nil {
+		return fmt.Errorf("no -v logging flag registered")
+	}
+	if config.CurrentLogLevel == level && vFlag.Value.String() == fmt.Sprintf("%d", verbosity) {
+		return nil
+	}
+	if err := vFlag.Value.Set(fmt.Sprintf("%d", verbosity)); err != nil {
+		return fmt.Errorf("failed to set log level %q (-v=%d): %v", level, verbosity, err)
+	}
+
+	glog.Infof("Log level changed from %q to %q (-v=%d)", config.CurrentLogLevel, level, verbosity)
+	optr.eventRecorder.Eventf(config, corev1.EventTypeNormal, "LogLevelChanged", "Log level changed from %q to %q", config.CurrentLogLevel, level)
+
+	previous := config.CurrentLogLevel
+	config.CurrentLogLevel = level
+	actual, _, err := resourceapply.ApplyCVOConfigFromCache(ctx, optr.cvoConfigLister, optr.client.ClusterversionV1(), config)
+	if err != nil {
+		config.CurrentLogLevel = previous
+		return fmt.Errorf("failed to persist current log level %q: %v", level, err)
+	}
+	config.CurrentLogLevel = actual.CurrentLogLevel
+	return nil
+}
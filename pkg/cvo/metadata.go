@@ -0,0 +1,43 @@
+package cvo
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// crdMetadata returns the cached *metav1.PartialObjectMetadata for a
+// cluster-scoped CRD. syncCVOCRDs only needs to observe existence and
+// generation, so the crdLister is backed by a metadata-only informer rather
+// than a full CustomResourceDefinitionLister. syncCVOCRDs itself lives
+// outside this checkout, so this accessor has no in-tree caller yet; it
+// exists so the lister stays metadata-only when that call site lands.
+func (optr *Operator) crdMetadata(name string) (*metav1.PartialObjectMetadata, error) {
+	obj, err := optr.crdLister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	pom, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for CRD %q", obj, name)
+	}
+	return pom, nil
+}
+
+// deploymentMetadata returns the cached *metav1.PartialObjectMetadata for the
+// payload Deployment. Payload reconciliation only needs to observe existence
+// and generation, so the deployLister is backed by a metadata-only informer
+// rather than a full DeploymentLister. Payload reconciliation itself lives
+// outside this checkout, so this accessor has no in-tree caller yet; it
+// exists so the lister stays metadata-only when that call site lands.
+func (optr *Operator) deploymentMetadata(namespace, name string) (*metav1.PartialObjectMetadata, error) {
+	obj, err := optr.deployLister.ByNamespace(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	pom, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for deployment %s/%s", obj, namespace, name)
+	}
+	return pom, nil
+}
@@ -0,0 +1,145 @@
+package cvo
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newMetadataIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+func TestCRDMetadataReturnsPartialObjectMetadata(t *testing.T) {
+	indexer := newMetadataIndexer()
+	crd := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.com", Generation: 3}}
+	if err := indexer.Add(crd); err != nil {
+		t.Fatalf("failed to seed indexer: %v", err)
+	}
+
+	optr := &Operator{
+		crdLister: cache.NewGenericLister(indexer, schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}),
+	}
+
+	got, err := optr.crdMetadata("widgets.example.com")
+	if err != nil {
+		t.Fatalf("crdMetadata returned error: %v", err)
+	}
+	if got.Generation != 3 {
+		t.Errorf("got generation %d, want 3", got.Generation)
+	}
+}
+
+func TestDeploymentMetadataReturnsPartialObjectMetadata(t *testing.T) {
+	indexer := newMetadataIndexer()
+	deploy := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-cluster-version", Name: "cluster-version-operator", Generation: 2}}
+	if err := indexer.Add(deploy); err != nil {
+		t.Fatalf("failed to seed indexer: %v", err)
+	}
+
+	optr := &Operator{
+		deployLister: cache.NewGenericLister(indexer, schema.GroupResource{Group: "apps", Resource: "deployments"}),
+	}
+
+	got, err := optr.deploymentMetadata("openshift-cluster-version", "cluster-version-operator")
+	if err != nil {
+		t.Fatalf("deploymentMetadata returned error: %v", err)
+	}
+	if got.Generation != 2 {
+		t.Errorf("got generation %d, want 2", got.Generation)
+	}
+}
+
+func TestDeploymentMetadataNotFound(t *testing.T) {
+	optr := &Operator{
+		deployLister: cache.NewGenericLister(newMetadataIndexer(), schema.GroupResource{Group: "apps", Resource: "deployments"}),
+	}
+
+	if _, err := optr.deploymentMetadata("openshift-cluster-version", "missing"); err == nil {
+		t.Fatal("expected an error for a deployment that is not cached, got nil")
+	}
+}
+
+// syntheticFullCRD returns a CustomResourceDefinition with the kind of large
+// OpenAPIV3Schema real payload CRDs ship, standing in for what a full
+// CustomResourceDefinitionLister would have cached per object.
+func syntheticFullCRD(i int) *apiextv1beta1.CustomResourceDefinition {
+	properties := make(map[string]apiextv1beta1.JSONSchemaProps, 50)
+	for p := 0; p < 50; p++ {
+		properties[fmt.Sprintf("field%d", p)] = apiextv1beta1.JSONSchemaProps{
+			Type:        "string",
+			Description: "a field in a synthetic CRD schema, large enough to simulate a real operator's validation schema",
+		}
+	}
+	return &apiextv1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("widget%d.example.com", i), Generation: 1},
+		Spec: apiextv1beta1.CustomResourceDefinitionSpec{
+			Group:   "example.com",
+			Version: "v1",
+			Names: apiextv1beta1.CustomResourceDefinitionNames{
+				Plural: fmt.Sprintf("widget%ds", i),
+				Kind:   fmt.Sprintf("Widget%d", i),
+			},
+			Validation: &apiextv1beta1.CustomResourceValidation{
+				OpenAPIV3Schema: &apiextv1beta1.JSONSchemaProps{
+					Type:       "object",
+					Properties: properties,
+				},
+			},
+		},
+	}
+}
+
+// syntheticCRDMetadata is the metadata-only equivalent of syntheticFullCRD:
+// what crdLister actually caches.
+func syntheticCRDMetadata(i int) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("widget%d.example.com", i), Generation: 1}}
+}
+
+// encodedSize approximates the in-cache footprint of objs by JSON-encoding
+// each of them and summing the encoded length. It is a cheap, deterministic
+// stand-in for measuring resident set size directly.
+func encodedSize(t *testing.T, objs []interface{}) int {
+	t.Helper()
+	total := 0
+	for _, obj := range objs {
+		b, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatalf("failed to marshal %T: %v", obj, err)
+		}
+		total += len(b)
+	}
+	return total
+}
+
+// TestMetadataOnlyCRDCacheIsSmallerThanFullObjects demonstrates the memory
+// win a metadata-only crdLister gives up over a full
+// CustomResourceDefinitionLister for a synthetic 500-CRD payload: this repo
+// has no toolchain available to profile real RSS, so encoded size of the
+// cached objects stands in as a deterministic proxy.
+func TestMetadataOnlyCRDCacheIsSmallerThanFullObjects(t *testing.T) {
+	const crdCount = 500
+
+	fullIndexer := newMetadataIndexer()
+	metadataIndexer := newMetadataIndexer()
+	for i := 0; i < crdCount; i++ {
+		if err := fullIndexer.Add(syntheticFullCRD(i)); err != nil {
+			t.Fatalf("failed to seed full CRD indexer: %v", err)
+		}
+		if err := metadataIndexer.Add(syntheticCRDMetadata(i)); err != nil {
+			t.Fatalf("failed to seed metadata CRD indexer: %v", err)
+		}
+	}
+
+	fullSize := encodedSize(t, fullIndexer.List())
+	metadataSize := encodedSize(t, metadataIndexer.List())
+
+	if metadataSize >= fullSize/2 {
+		t.Errorf("expected metadata-only cache for %d CRDs to use well under half the space of full objects, got %d bytes (metadata) vs %d bytes (full)", crdCount, metadataSize, fullSize)
+	}
+}
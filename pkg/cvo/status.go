@@ -0,0 +1,127 @@
+package cvo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	configv1 "github.com/openshift/api/config/v1"
+	cvv1 "github.com/openshift/cluster-version-operator/pkg/apis/clusterversion.openshift.io/v1"
+	"github.com/openshift/cluster-version-operator/pkg/version"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncStatus reconciles the ClusterOperator that reports CVO's own rollout
+// state: Progressing while the payload is being applied, Available once it
+// lands. It clears Degraded; only syncDegradedStatus sets it to True.
+func (optr *Operator) syncStatus(ctx context.Context, config *cvv1.CVOConfig, progressing bool, message string) error {
+	co, err := optr.getOrCreateClusterOperator(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get ClusterOperator %s: %v", optr.name, err)
+	}
+
+	v1helpers.SetStatusCondition(&co.Status.Conditions, configv1.ClusterOperatorStatusCondition{
+		Type:    configv1.OperatorProgressing,
+		Status:  conditionBool(progressing),
+		Message: message,
+	})
+	v1helpers.SetStatusCondition(&co.Status.Conditions, configv1.ClusterOperatorStatusCondition{
+		Type:    configv1.OperatorAvailable,
+		Status:  conditionBool(availableStatus(co, progressing)),
+		Message: message,
+	})
+	v1helpers.SetStatusCondition(&co.Status.Conditions, configv1.ClusterOperatorStatusCondition{
+		Type:   configv1.OperatorDegraded,
+		Status: configv1.ConditionFalse,
+	})
+	v1helpers.SetStatusCondition(&co.Status.Conditions, configv1.ClusterOperatorStatusCondition{
+		Type:   configv1.OperatorUpgradeable,
+		Status: configv1.ConditionTrue,
+	})
+
+	co.Status.RelatedObjects = optr.relatedObjects(config)
+	co.Status.Versions = []configv1.OperandVersion{
+		{Name: "operator", Version: version.Raw},
+	}
+
+	_, err = optr.configClient.ConfigV1().ClusterOperators().UpdateStatus(ctx, co, metav1.UpdateOptions{})
+	return err
+}
+
+// syncDegradedStatus reports a terminal sync error as Degraded on the
+// ClusterOperator once degradedStatusWriter sees maxRetries requeues. After a
+// successful status update it returns the original syncErr, which the caller
+// logs.
+func (optr *Operator) syncDegradedStatus(ctx context.Context, syncErr error) error {
+	co, err := optr.getOrCreateClusterOperator(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get ClusterOperator %s while reporting degraded status for %v: %v", optr.name, syncErr, err)
+	}
+
+	v1helpers.SetStatusCondition(&co.Status.Conditions, configv1.ClusterOperatorStatusCondition{
+		Type:    configv1.OperatorDegraded,
+		Status:  configv1.ConditionTrue,
+		Reason:  "SyncError",
+		Message: syncErr.Error(),
+	})
+	v1helpers.SetStatusCondition(&co.Status.Conditions, configv1.ClusterOperatorStatusCondition{
+		Type:   configv1.OperatorProgressing,
+		Status: configv1.ConditionFalse,
+	})
+
+	if _, err := optr.configClient.ConfigV1().ClusterOperators().UpdateStatus(ctx, co, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to report degraded status for %v: %v", syncErr, err)
+	}
+	return syncErr
+}
+
+// getOrCreateClusterOperator returns CVO's own ClusterOperator, creating an
+// empty one if it does not exist yet.
+func (optr *Operator) getOrCreateClusterOperator(ctx context.Context) (*configv1.ClusterOperator, error) {
+	co, err := optr.clusterOperatorLister.Get(optr.name)
+	if err == nil {
+		return co.DeepCopy(), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	return optr.configClient.ConfigV1().ClusterOperators().Create(ctx, &configv1.ClusterOperator{
+		ObjectMeta: metav1.ObjectMeta{Name: optr.name},
+	}, metav1.CreateOptions{})
+}
+
+// relatedObjects lists the objects an administrator should gather alongside
+// this ClusterOperator when debugging a rollout, e.g. via "oc adm must-gather".
+func (optr *Operator) relatedObjects(config *cvv1.CVOConfig) []configv1.ObjectReference {
+	return []configv1.ObjectReference{
+		{Group: cvv1.SchemeGroupVersion.Group, Resource: "cvoconfigs", Namespace: config.Namespace, Name: config.Name},
+		{Group: "apps", Resource: "deployments", Namespace: optr.namespace, Name: optr.name},
+		{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+	}
+}
+
+// availableStatus reports whether CVO should claim Available. Available and
+// Progressing are independent axes: once the operator has ever completed a
+// sync it stays Available through routine updates, so a healthy cluster does
+// not flap ClusterOperatorDown on every ResyncEvery tick. Only the very first
+// sync, before any Available condition has been recorded, reports unavailable
+// while progressing.
+func availableStatus(co *configv1.ClusterOperator, progressing bool) bool {
+	if !progressing {
+		return true
+	}
+	if existing := v1helpers.FindStatusCondition(co.Status.Conditions, configv1.OperatorAvailable); existing != nil {
+		return existing.Status == configv1.ConditionTrue
+	}
+	return false
+}
+
+func conditionBool(b bool) configv1.ConditionStatus {
+	if b {
+		return configv1.ConditionTrue
+	}
+	return configv1.ConditionFalse
+}
@@ -0,0 +1,8 @@
+// Package version holds the operator's own version, set via -ldflags at
+// build time so ClusterOperator.Status.Versions can report it.
+package version
+
+// Raw is the operator's own version. The build overrides this with the real
+// version string; it is only "unknown" when running outside the normal
+// build (e.g. "go run" or unit tests).
+var Raw = "unknown"